@@ -0,0 +1,91 @@
+package grpcgcp
+
+import (
+	"context"
+
+	pb "github.com/GoogleCloudPlatform/grpc-gcp-go/grpcgcp/grpc_gcp"
+)
+
+// affinityKeyContextKey is the context.Value key under which the affinity
+// key for the call's method is carried, set by NewContextWithAffinityKey.
+type affinityKeyContextKey struct{}
+
+// NewContextWithAffinityKey returns a context carrying key as the call's
+// affinity key. The "grpc.gcp" balancer has no access to the request or
+// response message, so it cannot extract the affinity key field itself the
+// way the server-side grpc-gcp client libraries do; callers that configure
+// a method with an AffinityConfig must set the key on the call's context
+// (typically from a unary/stream interceptor) for gcpPicker.Pick to apply
+// BIND/BOUND/UNBIND routing.
+func NewContextWithAffinityKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, affinityKeyContextKey{}, key)
+}
+
+// affinityKeyFromContext returns the affinity key set by
+// NewContextWithAffinityKey, if any.
+func affinityKeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(affinityKeyContextKey{}).(string)
+	return key, ok
+}
+
+// affinityConfigForMethod returns the AffinityConfig configured for
+// fullMethod, matched against each MethodConfig's Name entries, or nil if
+// the method has no affinity configured.
+func affinityConfigForMethod(cfg *pb.ApiConfig, fullMethod string) *pb.AffinityConfig {
+	for _, m := range cfg.Method {
+		for _, name := range m.Name {
+			if name == fullMethod {
+				return m.Affinity
+			}
+		}
+	}
+	return nil
+}
+
+// bindSubConnLocked associates key with ref in the affinity map, as driven
+// by a method configured with AffinityConfig_BIND. Callers must hold b.mu.
+func (b *gcpBalancer) bindSubConnLocked(key string, ref *subConnRef) {
+	b.affinityMap[key] = ref
+	b.metrics.RecordAffinityResolution(pb.AffinityConfig_BIND)
+	b.metrics.RecordAffinityMapSize(len(b.affinityMap))
+}
+
+// unbindSubConnLocked removes key from the affinity map, as driven by a
+// method configured with AffinityConfig_UNBIND. Callers must hold b.mu.
+func (b *gcpBalancer) unbindSubConnLocked(key string) {
+	delete(b.affinityMap, key)
+	b.metrics.RecordAffinityResolution(pb.AffinityConfig_UNBIND)
+	b.metrics.RecordAffinityMapSize(len(b.affinityMap))
+}
+
+// boundSubConnLocked looks up the SubConn bound to key, as driven by a
+// method configured with AffinityConfig_BOUND. Callers must hold b.mu.
+func (b *gcpBalancer) boundSubConnLocked(key string) (*subConnRef, bool) {
+	ref, ok := b.affinityMap[key]
+	if ok {
+		b.metrics.RecordAffinityResolution(pb.AffinityConfig_BOUND)
+	}
+	return ref, ok
+}
+
+// bindSubConn, unbindSubConn and boundSubConn are locking wrappers around
+// the *Locked affinity map primitives above, for use by gcpPicker.Pick,
+// which does not itself hold b.mu.
+
+func (b *gcpBalancer) bindSubConn(key string, ref *subConnRef) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bindSubConnLocked(key, ref)
+}
+
+func (b *gcpBalancer) unbindSubConn(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.unbindSubConnLocked(key)
+}
+
+func (b *gcpBalancer) boundSubConn(key string) (*subConnRef, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.boundSubConnLocked(key)
+}
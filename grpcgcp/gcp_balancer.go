@@ -0,0 +1,532 @@
+// Package grpcgcp provides a gRPC balancer that maintains a pool of
+// channels (SubConns) spread across the resolved backend endpoints and
+// binds affinity keys to specific channels, as described by the
+// "grpc.gcp" service config.
+package grpcgcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/GoogleCloudPlatform/grpc-gcp-go/grpcgcp/grpc_gcp"
+)
+
+// Name is the name of the grpc_gcp balancer, registered as a gRPC
+// service config load balancing policy.
+const Name = "grpc.gcp"
+
+const (
+	defaultMinSize    uint32 = 1
+	defaultMaxSize    uint32 = 10
+	defaultMaxStreams uint32 = 100
+
+	// endpointRefreshInterval is how often the balancer asks the resolver to
+	// re-resolve, so a cluster's endpoint membership is periodically picked
+	// up even if the resolver's own watch doesn't notice a change on its own.
+	endpointRefreshInterval = 5 * time.Minute
+)
+
+// deErr is a DEADLINE_EXCEEDED status error. The unresponsive SubConn
+// detection does not compare against it: isDeadlineExceeded recognizes any
+// error with that status code, or context.DeadlineExceeded.
+var deErr = status.Error(codes.DeadlineExceeded, "deadline exceeded")
+
+func init() {
+	balancer.Register(newBuilder())
+}
+
+// GcpBalancerConfig wraps the grpc.gcp.ApiConfig service config message so
+// it can be carried through balancer.ClientConnState.BalancerConfig.
+type GcpBalancerConfig struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+
+	ApiConfig *pb.ApiConfig `json:"apiConfig,omitempty"`
+
+	// MetricsSink, if set, receives pool and SubConn level observability
+	// events from the balancer. Defaults to a no-op sink.
+	MetricsSink MetricsSink `json:"-"`
+
+	// HealthWatcher, if set, overrides how ChannelPoolConfig.HealthCheck is
+	// watched. Defaults to watching grpc.health.v1.Health/Watch directly.
+	HealthWatcher HealthWatcher `json:"-"`
+}
+
+type gcpBalancerBuilder struct{}
+
+func newBuilder() balancer.Builder {
+	return &gcpBalancerBuilder{}
+}
+
+func (*gcpBalancerBuilder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	return &gcpBalancer{
+		cc:            cc,
+		dialCreds:     opts.DialCreds,
+		scRefs:        make(map[balancer.SubConn]*subConnRef),
+		affinityMap:   make(map[string]*subConnRef),
+		metrics:       noopMetricsSink{},
+		healthWatcher: defaultHealthWatcher,
+	}
+}
+
+func (*gcpBalancerBuilder) Name() string {
+	return Name
+}
+
+// ParseConfig implements balancer.ConfigParser, decoding the JSON service
+// config into a GcpBalancerConfig.
+func (*gcpBalancerBuilder) ParseConfig(c json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	cfg := &pb.ApiConfig{}
+	if err := json.Unmarshal(c, cfg); err != nil {
+		return nil, err
+	}
+	return &GcpBalancerConfig{ApiConfig: cfg}, nil
+}
+
+// gcpBalancer maintains a pool of SubConns spread round-robin across the
+// resolved endpoints and routes picks either by affinity key or by least
+// number of active streams.
+type gcpBalancer struct {
+	cc        balancer.ClientConn
+	dialCreds credentials.TransportCredentials
+
+	mu            sync.Mutex
+	cfg           *GcpBalancerConfig
+	scRefs        map[balancer.SubConn]*subConnRef
+	affinityMap   map[string]*subConnRef
+	picker        *gcpPicker
+	metrics       MetricsSink
+	healthWatcher HealthWatcher
+	nextScID      int
+	resolverErr   error
+
+	// endpoints is the most recent non-empty address list pushed by the
+	// resolver. SubConns are spread round-robin across it rather than each
+	// one dialing every address, so the pool actually fans out across a
+	// discovered cluster instead of replicating a single address N times.
+	endpoints       []resolver.Address
+	nextEndpointIdx int
+
+	endpointRefreshOnce sync.Once
+	endpointRefreshStop chan struct{}
+}
+
+// UpdateClientConnState applies the (possibly empty) service config, fills
+// in defaults, and ensures at least MinSize SubConns exist and are
+// connecting.
+func (b *gcpBalancer) UpdateClientConnState(ccs balancer.ClientConnState) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.cfg = withDefaults(ccs.BalancerConfig)
+	b.metrics = b.cfg.MetricsSink
+	b.healthWatcher = b.cfg.HealthWatcher
+	b.resolverErr = nil
+
+	b.endpointRefreshOnce.Do(b.startEndpointRefreshLocked)
+
+	prevEndpoints := b.endpoints
+	if addrs := ccs.ResolverState.Addresses; len(addrs) > 0 {
+		b.endpoints = addrs
+	}
+
+	for uint32(len(b.scRefs)) < b.cfg.ApiConfig.ChannelPool.MinSize {
+		if b.createSubConnLocked(b.nextEndpointLocked(nil)) == nil {
+			break
+		}
+	}
+
+	// A resolver update that changes an already-known endpoint set takes
+	// effect on existing SubConns immediately, rather than only on the next
+	// one created by the unresponsive-detection path, so multi-endpoint
+	// clusters that grow or shrink after the initial dial don't require a
+	// reconnect to be reflected in the pool. The very first update has no
+	// prior endpoints to compare against, so it is left to the MinSize loop
+	// above, which already spreads the initial SubConns round-robin.
+	if len(prevEndpoints) > 0 && !sameEndpoints(prevEndpoints, b.endpoints) {
+		b.redistributeEndpointsLocked()
+	}
+
+	// Make sure every known SubConn is at least attempting to connect, for
+	// example ones that were created by an earlier call and are still idle.
+	b.connectIdleLocked()
+
+	b.regeneratePickerLocked()
+	return nil
+}
+
+// startEndpointRefreshLocked starts a background goroutine that periodically
+// calls ResolveNow on the ClientConn, so the resolver re-pushes its current
+// state through UpdateClientConnState even between changes it would notice
+// on its own; that in turn drives redistributeEndpointsLocked if the
+// endpoint set has changed. It runs exactly once per balancer, started from
+// the first UpdateClientConnState call and stopped by Close. Callers must
+// hold b.mu.
+func (b *gcpBalancer) startEndpointRefreshLocked() {
+	stop := make(chan struct{})
+	b.endpointRefreshStop = stop
+
+	go func() {
+		ticker := time.NewTicker(endpointRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				b.cc.ResolveNow(resolver.ResolveNowOptions{})
+			}
+		}
+	}()
+}
+
+// sameEndpoints reports whether a and b list the same addresses in the
+// same order.
+func sameEndpoints(a, b []resolver.Address) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Addr != b[i].Addr {
+			return false
+		}
+	}
+	return true
+}
+
+// withDefaults returns a GcpBalancerConfig with zero-value fields replaced
+// by the package defaults.
+func withDefaults(lbCfg serviceconfig.LoadBalancingConfig) *GcpBalancerConfig {
+	cfg, _ := lbCfg.(*GcpBalancerConfig)
+	if cfg == nil {
+		cfg = &GcpBalancerConfig{}
+	}
+	if cfg.ApiConfig == nil {
+		cfg.ApiConfig = &pb.ApiConfig{}
+	}
+	if cfg.ApiConfig.ChannelPool == nil {
+		cfg.ApiConfig.ChannelPool = &pb.ChannelPoolConfig{}
+	}
+	if cfg.ApiConfig.Method == nil {
+		cfg.ApiConfig.Method = []*pb.MethodConfig{}
+	}
+	cp := cfg.ApiConfig.ChannelPool
+	if cp.MinSize == 0 {
+		cp.MinSize = defaultMinSize
+	}
+	if cp.MaxSize == 0 {
+		cp.MaxSize = defaultMaxSize
+	}
+	if cp.MaxConcurrentStreamsLowWatermark == 0 {
+		cp.MaxConcurrentStreamsLowWatermark = defaultMaxStreams
+	}
+	if cfg.MetricsSink == nil {
+		cfg.MetricsSink = noopMetricsSink{}
+	}
+	if cfg.HealthWatcher == nil {
+		cfg.HealthWatcher = defaultHealthWatcher
+	}
+	return cfg
+}
+
+// ResolverError is called distinct from UpdateClientConnState's own empty-
+// address updates: an empty but error-free resolver update is a valid
+// state (e.g. a resolver that legitimately has nothing to report yet),
+// while a ResolverError means the resolver itself failed.
+func (b *gcpBalancer) ResolverError(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.resolverErr = err
+	b.regeneratePickerLocked()
+}
+
+// UpdateSubConnState is deprecated in favor of the StateListener passed to
+// NewSubConn in createSubConnLocked; every SubConn this balancer creates
+// registers one, so gRPC never calls this. It exists only to satisfy the
+// balancer.Balancer interface.
+func (b *gcpBalancer) UpdateSubConnState(sc balancer.SubConn, scs balancer.SubConnState) {
+}
+
+// ExitIdle re-connects any SubConn that is currently idle, e.g. because it
+// was closed by the transport after a period of inactivity.
+func (b *gcpBalancer) ExitIdle() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.connectIdleLocked()
+}
+
+// connectIdleLocked calls Connect on every known SubConn that is currently
+// idle. Callers must hold b.mu.
+func (b *gcpBalancer) connectIdleLocked() {
+	for sc, ref := range b.scRefs {
+		if ref.getState() == connectivity.Idle {
+			sc.Connect()
+		}
+	}
+}
+
+// Close stops the periodic endpoint-refresh goroutine and cancels every
+// live SubConn's health watch. Without the latter, a SubConn's health-check
+// goroutine and its dedicated ClientConn are only torn down when that
+// SubConn is individually replaced, so closing the balancer while health
+// checking is enabled would otherwise leak one goroutine and one connection
+// per pooled SubConn for the life of the process.
+func (b *gcpBalancer) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.endpointRefreshStop != nil {
+		close(b.endpointRefreshStop)
+	}
+	for _, ref := range b.scRefs {
+		ref.markRemoved()
+	}
+}
+
+// handleSubConnStateLocked is ref's StateListener, registered with the
+// ClientConn at NewSubConn time. It tracks connectivity transitions and,
+// when a replacement SubConn created by the unresponsive-detection logic
+// becomes ready, tears down the SubConn it is replacing. Callers must hold
+// b.mu (the listener itself acquires it before calling in).
+func (b *gcpBalancer) handleSubConnStateLocked(ref *subConnRef, scs balancer.SubConnState) {
+	ref.setState(scs.ConnectivityState)
+
+	if scs.ConnectivityState == connectivity.Ready {
+		ref.resetUnresponsive()
+		if old := ref.replacementFor; old != nil {
+			old.subConn.Shutdown()
+			delete(b.scRefs, old.subConn)
+			old.markRemoved()
+			ref.replacementFor = nil
+		}
+	}
+
+	b.regeneratePickerLocked()
+}
+
+// nextEndpointLocked returns the resolver address to dial for the next
+// SubConn, distributing SubConns round-robin across the known endpoints.
+// If excl is non-nil and more than one endpoint is known, an endpoint
+// matching excl is skipped. Returns nil if no endpoints are known yet.
+// Callers must hold b.mu.
+func (b *gcpBalancer) nextEndpointLocked(excl *resolver.Address) []resolver.Address {
+	if len(b.endpoints) == 0 {
+		return nil
+	}
+	addr := b.endpoints[b.nextEndpointIdx%len(b.endpoints)]
+	b.nextEndpointIdx++
+	if excl != nil && len(b.endpoints) > 1 && addr.Addr == excl.Addr {
+		addr = b.endpoints[b.nextEndpointIdx%len(b.endpoints)]
+		b.nextEndpointIdx++
+	}
+	return []resolver.Address{addr}
+}
+
+// redistributeEndpointsLocked reassigns every known SubConn's address
+// round-robin across the current endpoint set via UpdateAddresses,
+// without tearing any of them down. Callers must hold b.mu.
+func (b *gcpBalancer) redistributeEndpointsLocked() {
+	if len(b.endpoints) == 0 {
+		return
+	}
+	for _, ref := range b.scRefs {
+		addrs := b.nextEndpointLocked(nil)
+		ref.addrs = addrs
+		ref.subConn.UpdateAddresses(addrs)
+	}
+}
+
+// createSubConnLocked creates a new SubConn, registers a StateListener and
+// its subConnRef, and kicks off connecting. Callers must hold b.mu.
+func (b *gcpBalancer) createSubConnLocked(addrs []resolver.Address) *subConnRef {
+	b.nextScID++
+	ref := &subConnRef{
+		id:                      fmt.Sprintf("sc-%d", b.nextScID),
+		addrs:                   addrs,
+		state:                   connectivity.Idle,
+		unresponsiveDetectionMs: b.cfg.ApiConfig.ChannelPool.UnresponsiveDetectionMs,
+	}
+
+	sc, err := b.cc.NewSubConn(addrs, balancer.NewSubConnOptions{
+		StateListener: func(scs balancer.SubConnState) {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.handleSubConnStateLocked(ref, scs)
+		},
+	})
+	if err != nil {
+		return nil
+	}
+	ref.subConn = sc
+	b.scRefs[sc] = ref
+	sc.Connect()
+
+	if hc := b.cfg.ApiConfig.ChannelPool.HealthCheck; hc != nil && len(addrs) > 0 {
+		b.startHealthWatchLocked(ref, hc)
+	}
+
+	return ref
+}
+
+// startHealthWatchLocked spawns a background watch of ref's health that
+// triggers the same refresh path as the deadline-exceeded detection when
+// the SubConn is reported unhealthy for too long. Callers must hold b.mu.
+func (b *gcpBalancer) startHealthWatchLocked(ref *subConnRef, hc *pb.HealthCheckConfig) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ref.healthCancel = cancel
+	target := ref.addrs[0].Addr
+	watcher := b.healthWatcher
+
+	go watcher.Watch(ctx, target, hc, b.dialCreds, func(reason string) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if ref.removed || ref.pendingReplacement != nil {
+			return
+		}
+		b.triggerRefreshLocked(ref, reason)
+	})
+}
+
+// triggerRefreshLocked records the refresh event and replaces ref,
+// whatever detection path (deadline-exceeded or health check) triggered
+// it. Callers must hold b.mu.
+func (b *gcpBalancer) triggerRefreshLocked(ref *subConnRef, reason string) {
+	b.metrics.RecordUnresponsiveRefresh(reason)
+	b.refreshSubConnLocked(ref)
+}
+
+// refreshSubConnLocked creates a replacement SubConn for old and sets up
+// exponential backoff (doubling old's current detection window) so that a
+// replacement that is itself unresponsive once ready, with no successful
+// completion yet, won't be replaced again too eagerly. The replacement is dialed on the next
+// endpoint in the round-robin rotation, skipping old's own endpoint
+// whenever another known endpoint exists, instead of redialing the
+// endpoint that was just flagged unresponsive. Callers must hold b.mu.
+func (b *gcpBalancer) refreshSubConnLocked(old *subConnRef) {
+	var excl *resolver.Address
+	if len(old.addrs) > 0 {
+		excl = &old.addrs[0]
+	}
+	next := b.createSubConnLocked(b.nextEndpointLocked(excl))
+	if next == nil {
+		return
+	}
+	next.replacementFor = old
+	next.unresponsiveDetectionMs = old.unresponsiveDetectionMs * 2
+	next.lastRespTime = time.Now()
+
+	old.pendingReplacement = next
+	old.deadlineExceededCount = 0
+	old.lastRespTime = time.Now()
+}
+
+// handleDone is invoked from the picker's Done callback for every
+// completed pick. It drives the deadline-exceeded based unresponsive
+// SubConn detection.
+func (b *gcpBalancer) handleDone(ref *subConnRef, info balancer.DoneInfo) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cpCfg := b.cfg.ApiConfig.ChannelPool
+	if cpCfg.UnresponsiveCalls == 0 {
+		return
+	}
+
+	if isDeadlineExceeded(info.Err) {
+		ref.deadlineExceededCount++
+		threshold := time.Duration(ref.unresponsiveDetectionMs) * time.Millisecond
+		if ref.pendingReplacement == nil &&
+			ref.deadlineExceededCount >= cpCfg.UnresponsiveCalls &&
+			time.Since(ref.lastRespTime) >= threshold {
+			reason := "deadline_exceeded_threshold"
+			if ref.unresponsiveDetectionMs != cpCfg.UnresponsiveDetectionMs {
+				reason = "doubled_backoff"
+			}
+			b.triggerRefreshLocked(ref, reason)
+		}
+		return
+	}
+
+	ref.deadlineExceededCount = 0
+	ref.lastRespTime = time.Now()
+	ref.unresponsiveDetectionMs = cpCfg.UnresponsiveDetectionMs
+}
+
+// maybeGrowPool creates an additional SubConn, up to MaxSize, once ref's
+// active stream count reaches MaxConcurrentStreamsLowWatermark. pickRef
+// calls it for every pick. On a load-based pick ref is the least busy ready
+// SubConn, so if even that SubConn has hit the watermark the whole ready
+// pool is considered saturated and due for growth. On a BOUND or UNBIND
+// pick ref is the bound SubConn, and the pool grows once that SubConn alone
+// reaches the watermark, whatever the load on the others.
+func (b *gcpBalancer) maybeGrowPool(ref *subConnRef) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cp := b.cfg.ApiConfig.ChannelPool
+	if uint32(len(b.scRefs)) >= cp.MaxSize {
+		return
+	}
+	if ref.getStreams() < int32(cp.MaxConcurrentStreamsLowWatermark) {
+		return
+	}
+	if b.createSubConnLocked(b.nextEndpointLocked(nil)) != nil {
+		b.regeneratePickerLocked()
+	}
+}
+
+func isDeadlineExceeded(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	return status.Code(err) == codes.DeadlineExceeded
+}
+
+// regeneratePickerLocked rebuilds the picker from the current set of
+// SubConns. Callers must hold b.mu.
+func (b *gcpBalancer) regeneratePickerLocked() {
+	ready := make([]*subConnRef, 0, len(b.scRefs))
+	for _, ref := range b.scRefs {
+		if ref.getState() == connectivity.Ready {
+			ready = append(ready, ref)
+		}
+		b.metrics.RecordSubConnStreams(ref.id, ref.getStreams())
+	}
+	b.metrics.RecordPoolSize(len(b.scRefs), len(ready))
+	b.metrics.RecordAffinityMapSize(len(b.affinityMap))
+
+	if len(ready) == 0 && b.resolverErr != nil {
+		b.cc.UpdateState(balancer.State{
+			ConnectivityState: connectivity.TransientFailure,
+			Picker:            &errPicker{err: b.resolverErr},
+		})
+		return
+	}
+
+	b.picker = &gcpPicker{
+		gb:        b,
+		scRefs:    ready,
+		apiConfig: b.cfg.ApiConfig,
+		lap:       b.cfg.ApiConfig.ChannelPool.LatencyAwarePicking,
+		metrics:   b.metrics,
+	}
+
+	state := connectivity.Connecting
+	if len(ready) > 0 {
+		state = connectivity.Ready
+	}
+	b.cc.UpdateState(balancer.State{ConnectivityState: state, Picker: b.picker})
+}
@@ -2,6 +2,10 @@ package grpcgcp
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -9,10 +13,11 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/google/go-cmp/cmp"
 	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/resolver"
-	"google.golang.org/protobuf/encoding/protojson"
-	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/grpc/status"
 
 	pb "github.com/GoogleCloudPlatform/grpc-gcp-go/grpcgcp/grpc_gcp"
 )
@@ -47,7 +52,8 @@ func TestDefaultConfig(t *testing.T) {
 	defer mockCtrl.Finish()
 
 	mockCC := mocks.NewMockClientConn(mockCtrl)
-	mockCC.EXPECT().NewSubConn(gomock.Any(), gomock.Any()).DoAndReturn(func(_, _ interface{}) (*mocks.MockSubConn, error) {
+	mockCC.EXPECT().UpdateState(gomock.Any()).AnyTimes()
+	mockCC.EXPECT().NewSubConn(gomock.Any(), gomock.Any()).DoAndReturn(func(_ []resolver.Address, _ balancer.NewSubConnOptions) (*mocks.MockSubConn, error) {
 		sc := mocks.NewMockSubConn(mockCtrl)
 		sc.EXPECT().Connect().AnyTimes()
 		sc.EXPECT().UpdateAddresses(gomock.Any()).AnyTimes()
@@ -70,7 +76,7 @@ func TestDefaultConfig(t *testing.T) {
 		ResolverState: resolver.State{},
 	})
 
-	if diff := cmp.Diff(wantCfg, b.cfg.ApiConfig, protocmp.Transform()); diff != "" {
+	if diff := cmp.Diff(wantCfg, b.cfg.ApiConfig); diff != "" {
 		t.Errorf("gcp_balancer config has unexpected difference (-want +got):\n%v", diff)
 	}
 
@@ -81,7 +87,7 @@ func TestDefaultConfig(t *testing.T) {
 		BalancerConfig: &GcpBalancerConfig{},
 	})
 
-	if diff := cmp.Diff(wantCfg, b.cfg.ApiConfig, protocmp.Transform()); diff != "" {
+	if diff := cmp.Diff(wantCfg, b.cfg.ApiConfig); diff != "" {
 		t.Errorf("gcp_balancer config has unexpected difference (-want +got):\n%v", diff)
 	}
 }
@@ -91,6 +97,7 @@ func TestConfig(t *testing.T) {
 	defer mockCtrl.Finish()
 
 	mockCC := mocks.NewMockClientConn(mockCtrl)
+	mockCC.EXPECT().UpdateState(gomock.Any()).AnyTimes()
 	mockCC.EXPECT().NewSubConn(gomock.Any(), gomock.Any()).DoAndReturn(func(_, _ interface{}) (*mocks.MockSubConn, error) {
 		sc := mocks.NewMockSubConn(mockCtrl)
 		sc.EXPECT().Connect().AnyTimes()
@@ -107,21 +114,25 @@ func TestConfig(t *testing.T) {
 		},
 	})
 
-	if diff := cmp.Diff(testApiConfig, b.cfg.ApiConfig, protocmp.Transform()); diff != "" {
+	if diff := cmp.Diff(testApiConfig, b.cfg.ApiConfig); diff != "" {
 		t.Errorf("gcp_balancer config has unexpected difference (-want +got):\n%v", diff)
 	}
 }
 
 func TestParseConfig(t *testing.T) {
-	json, err := protojson.Marshal(testApiConfig)
+	raw, err := json.Marshal(testApiConfig)
 	if err != nil {
 		t.Fatalf("cannot encode ApiConfig: %v", err)
 	}
-	cfg, err := newBuilder().(balancer.ConfigParser).ParseConfig(json)
+	cfg, err := newBuilder().(balancer.ConfigParser).ParseConfig(raw)
 	if err != nil {
 		t.Fatalf("ParseConfig returns error: %v, want: nil", err)
 	}
-	if diff := cmp.Diff(testApiConfig, cfg, protocmp.Transform()); diff != "" {
+	got, ok := cfg.(*GcpBalancerConfig)
+	if !ok {
+		t.Fatalf("ParseConfig() returned %T, want *GcpBalancerConfig", cfg)
+	}
+	if diff := cmp.Diff(testApiConfig, got.ApiConfig); diff != "" {
 		t.Errorf("ParseConfig() result has unexpected difference (-want +got):\n%v", diff)
 	}
 }
@@ -131,6 +142,7 @@ func TestCreatesMinSubConns(t *testing.T) {
 	defer mockCtrl.Finish()
 
 	mockCC := mocks.NewMockClientConn(mockCtrl)
+	mockCC.EXPECT().UpdateState(gomock.Any()).AnyTimes()
 	newSCs := []*mocks.MockSubConn{}
 	mockCC.EXPECT().NewSubConn(gomock.Any(), gomock.Any()).DoAndReturn(func(_, _ interface{}) (*mocks.MockSubConn, error) {
 		newSC := mocks.NewMockSubConn(mockCtrl)
@@ -165,20 +177,180 @@ func TestCreatesMinSubConns(t *testing.T) {
 	}
 }
 
+func TestDistributesSubConnsAcrossEndpoints(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	endpoints := []resolver.Address{{Addr: "10.0.0.1:80"}, {Addr: "10.0.0.2:80"}}
+	var dialed []string
+	mockCC := mocks.NewMockClientConn(mockCtrl)
+	mockCC.EXPECT().UpdateState(gomock.Any()).AnyTimes()
+	mockCC.EXPECT().NewSubConn(gomock.Any(), gomock.Any()).DoAndReturn(func(addrs []resolver.Address, _ balancer.NewSubConnOptions) (*mocks.MockSubConn, error) {
+		dialed = append(dialed, addrs[0].Addr)
+		sc := mocks.NewMockSubConn(mockCtrl)
+		sc.EXPECT().Connect().AnyTimes()
+		sc.EXPECT().UpdateAddresses(gomock.Any()).AnyTimes()
+		return sc, nil
+	}).Times(4)
+
+	b := newBuilder().Build(mockCC, balancer.BuildOptions{}).(*gcpBalancer)
+	b.UpdateClientConnState(balancer.ClientConnState{
+		ResolverState: resolver.State{Addresses: endpoints},
+		BalancerConfig: &GcpBalancerConfig{
+			ApiConfig: &pb.ApiConfig{
+				ChannelPool: &pb.ChannelPoolConfig{
+					MinSize: 4,
+					MaxSize: 4,
+				},
+			},
+		},
+	})
+
+	want := []string{"10.0.0.1:80", "10.0.0.2:80", "10.0.0.1:80", "10.0.0.2:80"}
+	if diff := cmp.Diff(want, dialed); diff != "" {
+		t.Errorf("SubConns dialed endpoints has unexpected difference (-want +got):\n%v", diff)
+	}
+}
+
+func TestRefreshPicksADifferentEndpoint(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	endpoints := []resolver.Address{{Addr: "10.0.0.1:80"}, {Addr: "10.0.0.2:80"}}
+	var dialed []string
+	listeners := []func(balancer.SubConnState){}
+	mockCC := mocks.NewMockClientConn(mockCtrl)
+	mockCC.EXPECT().UpdateState(gomock.Any()).AnyTimes()
+	mockCC.EXPECT().NewSubConn(gomock.Any(), gomock.Any()).DoAndReturn(func(addrs []resolver.Address, opts balancer.NewSubConnOptions) (*mocks.MockSubConn, error) {
+		dialed = append(dialed, addrs[0].Addr)
+		sc := mocks.NewMockSubConn(mockCtrl)
+		sc.EXPECT().Connect().AnyTimes()
+		sc.EXPECT().UpdateAddresses(gomock.Any()).AnyTimes()
+		listeners = append(listeners, opts.StateListener)
+		return sc, nil
+	}).Times(2)
+
+	b := newBuilder().Build(mockCC, balancer.BuildOptions{}).(*gcpBalancer)
+	b.UpdateClientConnState(balancer.ClientConnState{
+		ResolverState: resolver.State{Addresses: endpoints},
+		BalancerConfig: &GcpBalancerConfig{
+			ApiConfig: &pb.ApiConfig{
+				ChannelPool: &pb.ChannelPoolConfig{
+					MinSize:                 1,
+					MaxSize:                 1,
+					UnresponsiveDetectionMs: 0,
+					UnresponsiveCalls:       1,
+				},
+			},
+		},
+	})
+
+	// The first SubConn dialed endpoints[0]; triggering a refresh should
+	// dial the other known endpoint rather than endpoints[0] again.
+	listeners[0](balancer.SubConnState{ConnectivityState: connectivity.Ready})
+	pr, err := b.picker.Pick(balancer.PickInfo{FullMethodName: "", Ctx: context.Background()})
+	if err != nil {
+		t.Fatalf("gcpPicker.Pick returned error: %v", err)
+	}
+	pr.Done(balancer.DoneInfo{Err: deErr})
+
+	if got, want := dialed, []string{"10.0.0.1:80", "10.0.0.2:80"}; cmp.Diff(want, got) != "" {
+		t.Errorf("SubConns dialed endpoints = %v, want %v", got, want)
+	}
+}
+
+// TestRedistributesOnEndpointSetChange covers the case where the resolver
+// pushes a changed endpoint set (e.g. the cluster scaled) after the pool's
+// initial SubConns already exist: redistributeEndpointsLocked should spread
+// them across the new set via UpdateAddresses rather than leaving them all
+// pointed at endpoints that may no longer include the full cluster.
+func TestRedistributesOnEndpointSetChange(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	var updated []string
+	mockCC := mocks.NewMockClientConn(mockCtrl)
+	mockCC.EXPECT().UpdateState(gomock.Any()).AnyTimes()
+	mockCC.EXPECT().NewSubConn(gomock.Any(), gomock.Any()).DoAndReturn(func(addrs []resolver.Address, _ balancer.NewSubConnOptions) (*mocks.MockSubConn, error) {
+		sc := mocks.NewMockSubConn(mockCtrl)
+		sc.EXPECT().Connect().AnyTimes()
+		sc.EXPECT().UpdateAddresses(gomock.Any()).Do(func(addrs []resolver.Address) {
+			updated = append(updated, addrs[0].Addr)
+		}).AnyTimes()
+		return sc, nil
+	}).Times(2)
+
+	cfg := &GcpBalancerConfig{
+		ApiConfig: &pb.ApiConfig{
+			ChannelPool: &pb.ChannelPoolConfig{
+				MinSize: 2,
+				MaxSize: 2,
+			},
+		},
+	}
+	b := newBuilder().Build(mockCC, balancer.BuildOptions{}).(*gcpBalancer)
+	b.UpdateClientConnState(balancer.ClientConnState{
+		ResolverState:  resolver.State{Addresses: []resolver.Address{{Addr: "10.0.0.1:80"}}},
+		BalancerConfig: cfg,
+	})
+
+	// The endpoint set changes from one address to two; the two existing
+	// SubConns should each get an UpdateAddresses call spreading them across
+	// the new set, without any new SubConn being created.
+	b.UpdateClientConnState(balancer.ClientConnState{
+		ResolverState:  resolver.State{Addresses: []resolver.Address{{Addr: "10.0.0.1:80"}, {Addr: "10.0.0.2:80"}}},
+		BalancerConfig: cfg,
+	})
+
+	// redistributeEndpointsLocked iterates scRefs, a map, so which SubConn is
+	// assigned which endpoint first is unordered; only the resulting set of
+	// addresses handed out is deterministic.
+	sort.Strings(updated)
+	want := []string{"10.0.0.1:80", "10.0.0.2:80"}
+	if diff := cmp.Diff(want, updated); diff != "" {
+		t.Errorf("UpdateAddresses calls after endpoint set change has unexpected difference (-want +got):\n%v", diff)
+	}
+}
+
+func TestResolverErrorReportsTransientFailure(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	wantErr := errors.New("resolver is broken")
+	var gotState balancer.State
+	mockCC := mocks.NewMockClientConn(mockCtrl)
+	mockCC.EXPECT().UpdateState(gomock.Any()).Do(func(s balancer.State) { gotState = s }).AnyTimes()
+
+	b := newBuilder().Build(mockCC, balancer.BuildOptions{}).(*gcpBalancer)
+	b.cfg = withDefaults(nil)
+	b.metrics = noopMetricsSink{}
+	b.ResolverError(wantErr)
+
+	if gotState.ConnectivityState != connectivity.TransientFailure {
+		t.Fatalf("ConnectivityState = %v, want %v", gotState.ConnectivityState, connectivity.TransientFailure)
+	}
+	if _, err := gotState.Picker.Pick(balancer.PickInfo{}); err != wantErr {
+		t.Fatalf("Picker.Pick returned error %v, want %v", err, wantErr)
+	}
+}
+
 func TestRefreshesSubConnsWhenUnresponsive(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
-	// A slice to store all SubConns created by gcpBalancer's ClientConn.
+	// Slices to store all SubConns created by gcpBalancer's ClientConn and
+	// the StateListener each was registered with.
 	newSCs := []*mocks.MockSubConn{}
+	listeners := []func(balancer.SubConnState){}
 	mockCC := mocks.NewMockClientConn(mockCtrl)
 	mockCC.EXPECT().UpdateState(gomock.Any()).AnyTimes()
-	mockCC.EXPECT().RemoveSubConn(gomock.Any()).Times(2)
-	mockCC.EXPECT().NewSubConn(gomock.Any(), gomock.Any()).DoAndReturn(func(_, _ interface{}) (*mocks.MockSubConn, error) {
+	mockCC.EXPECT().NewSubConn(gomock.Any(), gomock.Any()).DoAndReturn(func(_ []resolver.Address, opts balancer.NewSubConnOptions) (*mocks.MockSubConn, error) {
 		newSC := mocks.NewMockSubConn(mockCtrl)
 		newSC.EXPECT().Connect().MinTimes(1)
 		newSC.EXPECT().UpdateAddresses(gomock.Any()).AnyTimes()
+		newSC.EXPECT().Shutdown().AnyTimes()
 		newSCs = append(newSCs, newSC)
+		listeners = append(listeners, opts.StateListener)
 		return newSC, nil
 	}).Times(6)
 
@@ -200,7 +372,7 @@ func TestRefreshesSubConnsWhenUnresponsive(t *testing.T) {
 	})
 
 	// Make subConn 0 ready.
-	b.UpdateSubConnState(newSCs[0], balancer.SubConnState{ConnectivityState: connectivity.Ready})
+	listeners[0](balancer.SubConnState{ConnectivityState: connectivity.Ready})
 
 	call := func(expSC balancer.SubConn, errOnDone error) {
 		ctx := context.TODO()
@@ -253,7 +425,7 @@ func TestRefreshesSubConnsWhenUnresponsive(t *testing.T) {
 	doneOnOld := pr.Done
 
 	// Make replacement subConn 3 ready.
-	b.UpdateSubConnState(newSCs[3], balancer.SubConnState{ConnectivityState: connectivity.Ready})
+	listeners[3](balancer.SubConnState{ConnectivityState: connectivity.Ready})
 
 	// Fresh subConn should be picked.
 	pr, err = b.picker.Pick(balancer.PickInfo{FullMethodName: "", Ctx: context.Background()})
@@ -281,7 +453,7 @@ func TestRefreshesSubConnsWhenUnresponsive(t *testing.T) {
 	}
 
 	// Make replacement subConn 4 ready.
-	b.UpdateSubConnState(newSCs[4], balancer.SubConnState{ConnectivityState: connectivity.Ready})
+	listeners[4](balancer.SubConnState{ConnectivityState: connectivity.Ready})
 
 	// Successful call to reset refresh counter.
 	call(newSCs[4], nil)
@@ -299,3 +471,439 @@ func TestRefreshesSubConnsWhenUnresponsive(t *testing.T) {
 		t.Fatalf("Unexpected number of subConns: %d, want %d", got, want)
 	}
 }
+
+func TestLatencyAwarePicking(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	newSCs := []*mocks.MockSubConn{}
+	listeners := []func(balancer.SubConnState){}
+	mockCC := mocks.NewMockClientConn(mockCtrl)
+	mockCC.EXPECT().UpdateState(gomock.Any()).AnyTimes()
+	mockCC.EXPECT().NewSubConn(gomock.Any(), gomock.Any()).DoAndReturn(func(_ []resolver.Address, opts balancer.NewSubConnOptions) (*mocks.MockSubConn, error) {
+		newSC := mocks.NewMockSubConn(mockCtrl)
+		newSC.EXPECT().Connect().AnyTimes()
+		newSC.EXPECT().UpdateAddresses(gomock.Any()).AnyTimes()
+		newSCs = append(newSCs, newSC)
+		listeners = append(listeners, opts.StateListener)
+		return newSC, nil
+	}).Times(2)
+
+	b := newBuilder().Build(mockCC, balancer.BuildOptions{}).(*gcpBalancer)
+	b.UpdateClientConnState(balancer.ClientConnState{
+		ResolverState: resolver.State{},
+		BalancerConfig: &GcpBalancerConfig{
+			ApiConfig: &pb.ApiConfig{
+				ChannelPool: &pb.ChannelPoolConfig{
+					MinSize: 2,
+					MaxSize: 2,
+					LatencyAwarePicking: &pb.LatencyAwarePicking{
+						WindowMs: 1000,
+						Weight:   1,
+					},
+				},
+			},
+		},
+	})
+
+	listeners[0](balancer.SubConnState{ConnectivityState: connectivity.Ready})
+	listeners[1](balancer.SubConnState{ConnectivityState: connectivity.Ready})
+
+	// Give subConn 1 a much higher observed latency than subConn 0, which
+	// has none recorded yet. With equal stream counts the picker should
+	// prefer the lower-latency subConn 0.
+	b.scRefs[newSCs[1]].recordLatency(500*time.Millisecond, 1000)
+
+	pr, err := b.picker.Pick(balancer.PickInfo{FullMethodName: "", Ctx: context.Background()})
+	if err != nil {
+		t.Fatalf("gcpPicker.Pick returned error: %v", err)
+	}
+	pr.Done(balancer.DoneInfo{})
+	if want := newSCs[0]; pr.SubConn != want {
+		t.Fatalf("gcpPicker.Pick returned %v, want the lower-latency SubConn %v", pr.SubConn, want)
+	}
+
+	if got := b.scRefs[newSCs[1]].Latency(); got < 400*time.Millisecond {
+		t.Errorf("SubConn latency accessor returned %v, want >= 400ms", got)
+	}
+}
+
+func TestAffinityRouting(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	newSCs := []*mocks.MockSubConn{}
+	listeners := []func(balancer.SubConnState){}
+	mockCC := mocks.NewMockClientConn(mockCtrl)
+	mockCC.EXPECT().UpdateState(gomock.Any()).AnyTimes()
+	mockCC.EXPECT().NewSubConn(gomock.Any(), gomock.Any()).DoAndReturn(func(_ []resolver.Address, opts balancer.NewSubConnOptions) (*mocks.MockSubConn, error) {
+		newSC := mocks.NewMockSubConn(mockCtrl)
+		newSC.EXPECT().Connect().AnyTimes()
+		newSC.EXPECT().UpdateAddresses(gomock.Any()).AnyTimes()
+		newSCs = append(newSCs, newSC)
+		listeners = append(listeners, opts.StateListener)
+		return newSC, nil
+	}).Times(2)
+
+	b := newBuilder().Build(mockCC, balancer.BuildOptions{}).(*gcpBalancer)
+	b.UpdateClientConnState(balancer.ClientConnState{
+		ResolverState: resolver.State{},
+		BalancerConfig: &GcpBalancerConfig{
+			ApiConfig: &pb.ApiConfig{
+				ChannelPool: &pb.ChannelPoolConfig{
+					MinSize: 2,
+					MaxSize: 2,
+				},
+				Method: []*pb.MethodConfig{
+					{
+						Name:     []string{"/test.Svc/Bind"},
+						Affinity: &pb.AffinityConfig{Command: pb.AffinityConfig_BIND, AffinityKey: "key"},
+					},
+					{
+						Name:     []string{"/test.Svc/Bound"},
+						Affinity: &pb.AffinityConfig{Command: pb.AffinityConfig_BOUND, AffinityKey: "key"},
+					},
+					{
+						Name:     []string{"/test.Svc/Unbind"},
+						Affinity: &pb.AffinityConfig{Command: pb.AffinityConfig_UNBIND, AffinityKey: "key"},
+					},
+				},
+			},
+		},
+	})
+
+	listeners[0](balancer.SubConnState{ConnectivityState: connectivity.Ready})
+	listeners[1](balancer.SubConnState{ConnectivityState: connectivity.Ready})
+
+	ctx := NewContextWithAffinityKey(context.Background(), "user1")
+
+	bindPr, err := b.picker.Pick(balancer.PickInfo{FullMethodName: "/test.Svc/Bind", Ctx: ctx})
+	if err != nil {
+		t.Fatalf("Pick(Bind) returned error: %v", err)
+	}
+	bindPr.Done(balancer.DoneInfo{})
+	bound := bindPr.SubConn
+
+	// A BOUND call for the same key should always land on the SubConn the
+	// BIND call picked, regardless of load-based scoring.
+	for i := 0; i < 3; i++ {
+		pr, err := b.picker.Pick(balancer.PickInfo{FullMethodName: "/test.Svc/Bound", Ctx: ctx})
+		if err != nil {
+			t.Fatalf("Pick(Bound) returned error: %v", err)
+		}
+		if pr.SubConn != bound {
+			t.Fatalf("Pick(Bound) returned %v, want the bound SubConn %v", pr.SubConn, bound)
+		}
+		pr.Done(balancer.DoneInfo{})
+	}
+
+	unbindPr, err := b.picker.Pick(balancer.PickInfo{FullMethodName: "/test.Svc/Unbind", Ctx: ctx})
+	if err != nil {
+		t.Fatalf("Pick(Unbind) returned error: %v", err)
+	}
+	if unbindPr.SubConn != bound {
+		t.Fatalf("Pick(Unbind) returned %v, want the bound SubConn %v", unbindPr.SubConn, bound)
+	}
+	unbindPr.Done(balancer.DoneInfo{})
+
+	// The binding is now gone and FallbackToReady defaults to false, so a
+	// further BOUND pick for the same key must fail rather than silently
+	// picking an arbitrary SubConn.
+	if _, err := b.picker.Pick(balancer.PickInfo{FullMethodName: "/test.Svc/Bound", Ctx: ctx}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Pick(Bound) after Unbind returned err %v, want an Unavailable error", err)
+	}
+}
+
+func TestAffinityFallsBackToReadyWhenUnbound(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockCC := mocks.NewMockClientConn(mockCtrl)
+	mockCC.EXPECT().UpdateState(gomock.Any()).AnyTimes()
+	var listener func(balancer.SubConnState)
+	mockCC.EXPECT().NewSubConn(gomock.Any(), gomock.Any()).DoAndReturn(func(_ []resolver.Address, opts balancer.NewSubConnOptions) (*mocks.MockSubConn, error) {
+		sc := mocks.NewMockSubConn(mockCtrl)
+		sc.EXPECT().Connect().AnyTimes()
+		sc.EXPECT().UpdateAddresses(gomock.Any()).AnyTimes()
+		listener = opts.StateListener
+		return sc, nil
+	}).Times(1)
+
+	sink := &fakeMetricsSink{}
+	b := newBuilder().Build(mockCC, balancer.BuildOptions{}).(*gcpBalancer)
+	b.UpdateClientConnState(balancer.ClientConnState{
+		ResolverState: resolver.State{},
+		BalancerConfig: &GcpBalancerConfig{
+			ApiConfig: &pb.ApiConfig{
+				ChannelPool: &pb.ChannelPoolConfig{
+					MinSize:         1,
+					MaxSize:         1,
+					FallbackToReady: true,
+				},
+				Method: []*pb.MethodConfig{
+					{
+						Name:     []string{"/test.Svc/Bound"},
+						Affinity: &pb.AffinityConfig{Command: pb.AffinityConfig_BOUND, AffinityKey: "key"},
+					},
+				},
+			},
+			MetricsSink: sink,
+		},
+	})
+	listener(balancer.SubConnState{ConnectivityState: connectivity.Ready})
+
+	ctx := NewContextWithAffinityKey(context.Background(), "never-bound")
+	pr, err := b.picker.Pick(balancer.PickInfo{FullMethodName: "/test.Svc/Bound", Ctx: ctx})
+	if err != nil {
+		t.Fatalf("Pick(Bound) with no binding and FallbackToReady returned error: %v", err)
+	}
+	pr.Done(balancer.DoneInfo{})
+
+	if sink.fallbacks != 1 {
+		t.Fatalf("MetricsSink.RecordFallback calls = %d, want 1", sink.fallbacks)
+	}
+}
+
+func TestPoolGrowsOnWatermark(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	newSCs := []*mocks.MockSubConn{}
+	listeners := []func(balancer.SubConnState){}
+	mockCC := mocks.NewMockClientConn(mockCtrl)
+	mockCC.EXPECT().UpdateState(gomock.Any()).AnyTimes()
+	mockCC.EXPECT().NewSubConn(gomock.Any(), gomock.Any()).DoAndReturn(func(_ []resolver.Address, opts balancer.NewSubConnOptions) (*mocks.MockSubConn, error) {
+		newSC := mocks.NewMockSubConn(mockCtrl)
+		newSC.EXPECT().Connect().AnyTimes()
+		newSC.EXPECT().UpdateAddresses(gomock.Any()).AnyTimes()
+		newSCs = append(newSCs, newSC)
+		listeners = append(listeners, opts.StateListener)
+		return newSC, nil
+	}).Times(2)
+
+	b := newBuilder().Build(mockCC, balancer.BuildOptions{}).(*gcpBalancer)
+	b.UpdateClientConnState(balancer.ClientConnState{
+		ResolverState: resolver.State{},
+		BalancerConfig: &GcpBalancerConfig{
+			ApiConfig: &pb.ApiConfig{
+				ChannelPool: &pb.ChannelPoolConfig{
+					MinSize:                          1,
+					MaxSize:                          2,
+					MaxConcurrentStreamsLowWatermark: 1,
+				},
+			},
+		},
+	})
+	listeners[0](balancer.SubConnState{ConnectivityState: connectivity.Ready})
+
+	if got, want := len(b.scRefs), 1; got != want {
+		t.Fatalf("gcpBalancer scRefs length is %v, want %v", got, want)
+	}
+
+	// The next pick gives the only SubConn one active stream, at the
+	// configured watermark, so that pick should grow the pool.
+	pr, err := b.picker.Pick(balancer.PickInfo{FullMethodName: "", Ctx: context.Background()})
+	if err != nil {
+		t.Fatalf("gcpPicker.Pick returned error: %v", err)
+	}
+	defer pr.Done(balancer.DoneInfo{})
+
+	if got, want := len(newSCs), 2; got != want {
+		t.Fatalf("Unexpected number of subConns after crossing watermark: %d, want %d", got, want)
+	}
+	if got, want := len(b.scRefs), 2; got != want {
+		t.Fatalf("gcpBalancer scRefs length is %v, want %v", got, want)
+	}
+}
+
+type fakeMetricsSink struct {
+	noopMetricsSink
+	poolTotal, poolReady int
+	refreshReasons       []string
+	fallbacks            int
+}
+
+func (f *fakeMetricsSink) RecordPoolSize(total, ready int) {
+	f.poolTotal, f.poolReady = total, ready
+}
+
+func (f *fakeMetricsSink) RecordUnresponsiveRefresh(reason string) {
+	f.refreshReasons = append(f.refreshReasons, reason)
+}
+
+func (f *fakeMetricsSink) RecordFallback() {
+	f.fallbacks++
+}
+
+func TestMetricsSinkReportsPoolAndRefreshEvents(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	newSCs := []*mocks.MockSubConn{}
+	listeners := []func(balancer.SubConnState){}
+	mockCC := mocks.NewMockClientConn(mockCtrl)
+	mockCC.EXPECT().UpdateState(gomock.Any()).AnyTimes()
+	mockCC.EXPECT().NewSubConn(gomock.Any(), gomock.Any()).DoAndReturn(func(_ []resolver.Address, opts balancer.NewSubConnOptions) (*mocks.MockSubConn, error) {
+		newSC := mocks.NewMockSubConn(mockCtrl)
+		newSC.EXPECT().Connect().AnyTimes()
+		newSC.EXPECT().UpdateAddresses(gomock.Any()).AnyTimes()
+		newSC.EXPECT().Shutdown().AnyTimes()
+		newSCs = append(newSCs, newSC)
+		listeners = append(listeners, opts.StateListener)
+		return newSC, nil
+	}).AnyTimes()
+
+	sink := &fakeMetricsSink{}
+	b := newBuilder().Build(mockCC, balancer.BuildOptions{}).(*gcpBalancer)
+	b.UpdateClientConnState(balancer.ClientConnState{
+		ResolverState: resolver.State{},
+		BalancerConfig: &GcpBalancerConfig{
+			ApiConfig: &pb.ApiConfig{
+				ChannelPool: &pb.ChannelPoolConfig{
+					MinSize:                 1,
+					MaxSize:                 1,
+					UnresponsiveDetectionMs: 0,
+					UnresponsiveCalls:       1,
+				},
+			},
+			MetricsSink: sink,
+		},
+	})
+
+	if sink.poolTotal != 1 {
+		t.Fatalf("MetricsSink.RecordPoolSize total = %d, want 1", sink.poolTotal)
+	}
+
+	listeners[0](balancer.SubConnState{ConnectivityState: connectivity.Ready})
+	if sink.poolReady != 1 {
+		t.Fatalf("MetricsSink.RecordPoolSize ready = %d, want 1", sink.poolReady)
+	}
+
+	pr, err := b.picker.Pick(balancer.PickInfo{FullMethodName: "", Ctx: context.Background()})
+	if err != nil {
+		t.Fatalf("gcpPicker.Pick returned error: %v", err)
+	}
+	pr.Done(balancer.DoneInfo{Err: deErr})
+
+	if want := []string{"deadline_exceeded_threshold"}; cmp.Diff(want, sink.refreshReasons) != "" {
+		t.Errorf("MetricsSink.RecordUnresponsiveRefresh reasons = %v, want %v", sink.refreshReasons, want)
+	}
+}
+
+// fakeHealthWatcher reports the watched SubConn unhealthy exactly once,
+// regardless of how many SubConns it is asked to watch.
+type fakeHealthWatcher struct {
+	triggered chan struct{}
+	fired     int32
+}
+
+func (f *fakeHealthWatcher) Watch(ctx context.Context, target string, cfg *pb.HealthCheckConfig, creds credentials.TransportCredentials, onUnhealthy func(string)) {
+	if atomic.CompareAndSwapInt32(&f.fired, 0, 1) {
+		onUnhealthy(healthRefreshNotServing)
+		close(f.triggered)
+	}
+	<-ctx.Done()
+}
+
+func TestHealthCheckTriggersRefresh(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	newSCs := []*mocks.MockSubConn{}
+	mockCC := mocks.NewMockClientConn(mockCtrl)
+	mockCC.EXPECT().UpdateState(gomock.Any()).AnyTimes()
+	mockCC.EXPECT().NewSubConn(gomock.Any(), gomock.Any()).DoAndReturn(func(_ []resolver.Address, _ balancer.NewSubConnOptions) (*mocks.MockSubConn, error) {
+		newSC := mocks.NewMockSubConn(mockCtrl)
+		newSC.EXPECT().Connect().AnyTimes()
+		newSC.EXPECT().UpdateAddresses(gomock.Any()).AnyTimes()
+		newSCs = append(newSCs, newSC)
+		return newSC, nil
+	}).Times(2)
+
+	watcher := &fakeHealthWatcher{triggered: make(chan struct{})}
+	b := newBuilder().Build(mockCC, balancer.BuildOptions{}).(*gcpBalancer)
+	b.UpdateClientConnState(balancer.ClientConnState{
+		ResolverState: resolver.State{Addresses: []resolver.Address{{Addr: "127.0.0.1:1"}}},
+		BalancerConfig: &GcpBalancerConfig{
+			ApiConfig: &pb.ApiConfig{
+				ChannelPool: &pb.ChannelPoolConfig{
+					MinSize: 1,
+					MaxSize: 1,
+					HealthCheck: &pb.HealthCheckConfig{
+						UnhealthyThresholdMs: 0,
+					},
+				},
+			},
+			HealthWatcher: watcher,
+		},
+	})
+
+	select {
+	case <-watcher.triggered:
+	case <-time.After(time.Second):
+		t.Fatal("health watcher was never invoked")
+	}
+
+	// onUnhealthy performs the refresh before it returns, and the fake
+	// watcher closes triggered only after that; still allow up to a second
+	// for the replacement SubConn to appear.
+	deadline := time.Now().Add(time.Second)
+	for len(newSCs) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if got, want := len(newSCs), 2; got != want {
+		t.Fatalf("Unexpected number of subConns: %d, want %d", got, want)
+	}
+}
+
+// blockingHealthWatcher runs until its ctx is canceled, reporting on
+// canceled whether that happened.
+type blockingHealthWatcher struct {
+	canceled chan struct{}
+}
+
+func (w *blockingHealthWatcher) Watch(ctx context.Context, target string, cfg *pb.HealthCheckConfig, creds credentials.TransportCredentials, onUnhealthy func(string)) {
+	<-ctx.Done()
+	close(w.canceled)
+}
+
+func TestCloseCancelsHealthWatches(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockCC := mocks.NewMockClientConn(mockCtrl)
+	mockCC.EXPECT().UpdateState(gomock.Any()).AnyTimes()
+	mockCC.EXPECT().NewSubConn(gomock.Any(), gomock.Any()).DoAndReturn(func(_ []resolver.Address, _ balancer.NewSubConnOptions) (*mocks.MockSubConn, error) {
+		sc := mocks.NewMockSubConn(mockCtrl)
+		sc.EXPECT().Connect().AnyTimes()
+		sc.EXPECT().UpdateAddresses(gomock.Any()).AnyTimes()
+		return sc, nil
+	}).Times(1)
+
+	watcher := &blockingHealthWatcher{canceled: make(chan struct{})}
+	b := newBuilder().Build(mockCC, balancer.BuildOptions{}).(*gcpBalancer)
+	b.UpdateClientConnState(balancer.ClientConnState{
+		ResolverState: resolver.State{Addresses: []resolver.Address{{Addr: "127.0.0.1:1"}}},
+		BalancerConfig: &GcpBalancerConfig{
+			ApiConfig: &pb.ApiConfig{
+				ChannelPool: &pb.ChannelPoolConfig{
+					MinSize: 1,
+					MaxSize: 1,
+					HealthCheck: &pb.HealthCheckConfig{
+						UnhealthyThresholdMs: 0,
+					},
+				},
+			},
+			HealthWatcher: watcher,
+		},
+	})
+
+	b.Close()
+
+	select {
+	case <-watcher.canceled:
+	case <-time.After(time.Second):
+		t.Fatal("Close did not cancel the SubConn's health watch")
+	}
+}
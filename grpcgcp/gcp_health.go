@@ -0,0 +1,104 @@
+package grpcgcp
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	pb "github.com/GoogleCloudPlatform/grpc-gcp-go/grpcgcp/grpc_gcp"
+)
+
+const (
+	healthRefreshNotServing   = "health_not_serving"
+	healthRefreshWatchFailure = "health_watch_failure"
+	healthWatchRetryInterval  = time.Second
+)
+
+// HealthWatcher watches the standard gRPC health checking protocol
+// (grpc.health.v1.Health/Watch) for a single SubConn's address, calling
+// onUnhealthy, with a reason label, to have that SubConn refreshed.
+// Watch blocks until ctx is canceled. creds is the balancer's own dial
+// credentials (from balancer.BuildOptions), reused so the health check
+// connection is secured the same way as the pooled SubConns; it may be nil.
+type HealthWatcher interface {
+	Watch(ctx context.Context, target string, cfg *pb.HealthCheckConfig, creds credentials.TransportCredentials, onUnhealthy func(reason string))
+}
+
+// grpcHealthWatcher is the default HealthWatcher: it dials target directly
+// and watches its grpc.health.v1.Health service, reconnecting on failure.
+// The first NOT_SERVING response or Watch failure after a SERVING one starts
+// an unhealthy stretch. The threshold (cfg.UnhealthyThresholdMs) is checked
+// only when a later NOT_SERVING response or failure arrives: if the stretch
+// has lasted at least that long, onUnhealthy is called and the stretch
+// starts over. A status that stays NOT_SERVING with no further responses
+// on the stream does not call onUnhealthy.
+type grpcHealthWatcher struct{}
+
+var defaultHealthWatcher HealthWatcher = grpcHealthWatcher{}
+
+func (grpcHealthWatcher) Watch(ctx context.Context, target string, cfg *pb.HealthCheckConfig, creds credentials.TransportCredentials, onUnhealthy func(reason string)) {
+	threshold := time.Duration(cfg.UnhealthyThresholdMs) * time.Millisecond
+	var unhealthySince time.Time
+
+	markUnhealthy := func(reason string) {
+		if unhealthySince.IsZero() {
+			unhealthySince = time.Now()
+			return
+		}
+		if time.Since(unhealthySince) >= threshold {
+			onUnhealthy(reason)
+			unhealthySince = time.Now()
+		}
+	}
+
+	dialOpt := grpc.WithInsecure()
+	if creds != nil {
+		dialOpt = grpc.WithTransportCredentials(creds)
+	}
+
+	for ctx.Err() == nil {
+		cc, err := grpc.DialContext(ctx, target, dialOpt)
+		if err != nil {
+			markUnhealthy(healthRefreshWatchFailure)
+			sleepOrDone(ctx, healthWatchRetryInterval)
+			continue
+		}
+
+		stream, err := healthpb.NewHealthClient(cc).Watch(ctx, &healthpb.HealthCheckRequest{Service: cfg.ServiceName})
+		if err != nil {
+			cc.Close()
+			markUnhealthy(healthRefreshWatchFailure)
+			sleepOrDone(ctx, healthWatchRetryInterval)
+			continue
+		}
+
+		for {
+			resp, err := stream.Recv()
+			if err == io.EOF || err != nil {
+				markUnhealthy(healthRefreshWatchFailure)
+				break
+			}
+			if resp.Status != healthpb.HealthCheckResponse_SERVING {
+				markUnhealthy(healthRefreshNotServing)
+			} else {
+				unhealthySince = time.Time{}
+			}
+		}
+
+		cc.Close()
+		sleepOrDone(ctx, healthWatchRetryInterval)
+	}
+}
+
+func sleepOrDone(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
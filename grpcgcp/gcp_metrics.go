@@ -0,0 +1,43 @@
+package grpcgcp
+
+import (
+	pb "github.com/GoogleCloudPlatform/grpc-gcp-go/grpcgcp/grpc_gcp"
+)
+
+// MetricsSink receives pool-level and per-SubConn observability events from
+// gcpBalancer, without requiring callers to wrap the balancer.Picker
+// themselves. Implementations must be safe for concurrent use.
+type MetricsSink interface {
+	// RecordPoolSize reports the total number of SubConns in the pool and
+	// how many of them are currently READY.
+	RecordPoolSize(total, ready int)
+	// RecordSubConnStreams reports the current active stream count for a
+	// single SubConn, identified by a stable, opaque id.
+	RecordSubConnStreams(id string, streams int32)
+	// RecordAffinityMapSize reports the number of entries in the affinity
+	// key to SubConn map.
+	RecordAffinityMapSize(size int)
+	// RecordAffinityResolution counts a BIND, UNBIND, or BOUND affinity
+	// command being applied.
+	RecordAffinityResolution(command pb.AffinityConfig_Command)
+	// RecordFallback counts a pick that fell back to an arbitrary READY
+	// SubConn because FallbackToReady was set and the preferred SubConn was
+	// unavailable.
+	RecordFallback()
+	// RecordUnresponsiveRefresh counts a SubConn replacement triggered by
+	// the unresponsive-SubConn detection, labeled with the reason it fired,
+	// e.g. "deadline_exceeded_threshold" or "doubled_backoff".
+	RecordUnresponsiveRefresh(reason string)
+}
+
+// noopMetricsSink is the default MetricsSink: it discards every event.
+type noopMetricsSink struct{}
+
+func (noopMetricsSink) RecordPoolSize(total, ready int)                            {}
+func (noopMetricsSink) RecordSubConnStreams(id string, streams int32)              {}
+func (noopMetricsSink) RecordAffinityMapSize(size int)                             {}
+func (noopMetricsSink) RecordAffinityResolution(command pb.AffinityConfig_Command) {}
+func (noopMetricsSink) RecordFallback()                                            {}
+func (noopMetricsSink) RecordUnresponsiveRefresh(reason string)                    {}
+
+var _ MetricsSink = noopMetricsSink{}
@@ -0,0 +1,101 @@
+package grpcgcp
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	pb "github.com/GoogleCloudPlatform/grpc-gcp-go/grpcgcp/grpc_gcp"
+)
+
+// otelMetricsSink is the default non-no-op MetricsSink, reporting pool and
+// SubConn observability as OpenTelemetry instruments.
+type otelMetricsSink struct {
+	poolSize      metric.Int64Gauge
+	readySize     metric.Int64Gauge
+	streams       metric.Int64Gauge
+	affinitySize  metric.Int64Gauge
+	affinityOps   metric.Int64Counter
+	fallbacks     metric.Int64Counter
+	refreshEvents metric.Int64Counter
+}
+
+// NewOpenTelemetryMetricsSink builds a MetricsSink that records pool and
+// SubConn observability using instruments created on meter. Pass it as
+// GcpBalancerConfig.MetricsSink to enable it.
+func NewOpenTelemetryMetricsSink(meter metric.Meter) (MetricsSink, error) {
+	poolSize, err := meter.Int64Gauge("grpcgcp.pool.size",
+		metric.WithDescription("Total number of SubConns in the channel pool"))
+	if err != nil {
+		return nil, err
+	}
+	readySize, err := meter.Int64Gauge("grpcgcp.pool.ready",
+		metric.WithDescription("Number of READY SubConns in the channel pool"))
+	if err != nil {
+		return nil, err
+	}
+	streams, err := meter.Int64Gauge("grpcgcp.subconn.streams",
+		metric.WithDescription("Active stream count for a single SubConn"))
+	if err != nil {
+		return nil, err
+	}
+	affinitySize, err := meter.Int64Gauge("grpcgcp.affinity.map_size",
+		metric.WithDescription("Number of entries in the affinity key to SubConn map"))
+	if err != nil {
+		return nil, err
+	}
+	affinityOps, err := meter.Int64Counter("grpcgcp.affinity.resolutions",
+		metric.WithDescription("Count of BIND/UNBIND/BOUND affinity resolutions"))
+	if err != nil {
+		return nil, err
+	}
+	fallbacks, err := meter.Int64Counter("grpcgcp.pick.fallbacks",
+		metric.WithDescription("Count of picks that fell back to an arbitrary READY SubConn"))
+	if err != nil {
+		return nil, err
+	}
+	refreshEvents, err := meter.Int64Counter("grpcgcp.subconn.unresponsive_refresh",
+		metric.WithDescription("Count of SubConn replacements triggered by unresponsive-SubConn detection"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &otelMetricsSink{
+		poolSize:      poolSize,
+		readySize:     readySize,
+		streams:       streams,
+		affinitySize:  affinitySize,
+		affinityOps:   affinityOps,
+		fallbacks:     fallbacks,
+		refreshEvents: refreshEvents,
+	}, nil
+}
+
+func (s *otelMetricsSink) RecordPoolSize(total, ready int) {
+	ctx := context.Background()
+	s.poolSize.Record(ctx, int64(total))
+	s.readySize.Record(ctx, int64(ready))
+}
+
+func (s *otelMetricsSink) RecordSubConnStreams(id string, streams int32) {
+	s.streams.Record(context.Background(), int64(streams), metric.WithAttributes(attribute.String("subconn_id", id)))
+}
+
+func (s *otelMetricsSink) RecordAffinityMapSize(size int) {
+	s.affinitySize.Record(context.Background(), int64(size))
+}
+
+func (s *otelMetricsSink) RecordAffinityResolution(command pb.AffinityConfig_Command) {
+	s.affinityOps.Add(context.Background(), 1, metric.WithAttributes(attribute.String("command", command.String())))
+}
+
+func (s *otelMetricsSink) RecordFallback() {
+	s.fallbacks.Add(context.Background(), 1)
+}
+
+func (s *otelMetricsSink) RecordUnresponsiveRefresh(reason string) {
+	s.refreshEvents.Add(context.Background(), 1, metric.WithAttributes(attribute.String("reason", reason)))
+}
+
+var _ MetricsSink = (*otelMetricsSink)(nil)
@@ -0,0 +1,252 @@
+package grpcgcp
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/GoogleCloudPlatform/grpc-gcp-go/grpcgcp/grpc_gcp"
+)
+
+// subConnRef tracks per-SubConn state used to pick the least busy SubConn
+// and to detect and refresh unresponsive SubConns.
+type subConnRef struct {
+	id      string
+	subConn balancer.SubConn
+	addrs   []resolver.Address
+
+	mu                      sync.Mutex
+	state                   connectivity.State
+	streamsCnt              int32
+	deadlineExceededCount   uint32
+	unresponsiveDetectionMs uint32
+	lastRespTime            time.Time
+
+	// replacementFor is set on a SubConn created to replace an unresponsive
+	// one; pendingReplacement is the inverse link set on the SubConn being
+	// replaced. Once the replacement becomes ready and the old SubConn is
+	// removed, replacementFor is cleared; pendingReplacement stays set on
+	// the removed SubConn, so late Done callbacks on it trigger no refresh.
+	replacementFor     *subConnRef
+	pendingReplacement *subConnRef
+	removed            bool
+	healthCancel       context.CancelFunc
+
+	latencyMu      sync.Mutex
+	latencyEwmaMs  float64
+	lastSampleTime time.Time
+}
+
+func (r *subConnRef) getState() connectivity.State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state
+}
+
+func (r *subConnRef) setState(s connectivity.State) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state = s
+}
+
+// resetUnresponsive clears the deadline-exceeded streak, e.g. because the
+// SubConn just became Ready. It deliberately leaves unresponsiveDetectionMs
+// untouched: that field already holds the right value (the base config for
+// a freshly created, non-replacement SubConn, or the doubled window
+// refreshSubConnLocked set for a replacement), and clobbering it back to
+// the base config here would defeat the exponential backoff between
+// repeated replacements of a still-unresponsive SubConn.
+func (r *subConnRef) resetUnresponsive() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deadlineExceededCount = 0
+	r.lastRespTime = time.Now()
+}
+
+func (r *subConnRef) markRemoved() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.removed = true
+	if r.healthCancel != nil {
+		r.healthCancel()
+	}
+}
+
+func (r *subConnRef) incStreams(delta int32) {
+	r.mu.Lock()
+	r.streamsCnt += delta
+	r.mu.Unlock()
+}
+
+func (r *subConnRef) getStreams() int32 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.streamsCnt
+}
+
+// recordLatency folds a Pick-to-Done sample into the SubConn's latency
+// EWMA, decaying older samples based on how long ago they were taken:
+// alpha = 1 - exp(-delta/windowMs).
+func (r *subConnRef) recordLatency(sample time.Duration, windowMs uint32) {
+	ms := float64(sample.Milliseconds())
+
+	r.latencyMu.Lock()
+	defer r.latencyMu.Unlock()
+
+	now := time.Now()
+	if r.lastSampleTime.IsZero() || windowMs == 0 {
+		r.latencyEwmaMs = ms
+	} else {
+		deltaMs := float64(now.Sub(r.lastSampleTime).Milliseconds())
+		alpha := 1 - math.Exp(-deltaMs/float64(windowMs))
+		r.latencyEwmaMs = (1-alpha)*r.latencyEwmaMs + alpha*ms
+	}
+	r.lastSampleTime = now
+}
+
+// Latency returns the current latency EWMA for the SubConn, for use by
+// tests and metrics exporters.
+func (r *subConnRef) Latency() time.Duration {
+	r.latencyMu.Lock()
+	defer r.latencyMu.Unlock()
+	return time.Duration(r.latencyEwmaMs) * time.Millisecond
+}
+
+// errPicker fails every pick with a fixed error. It backs the picker
+// installed when the resolver has errored and no SubConn is ready.
+type errPicker struct {
+	err error
+}
+
+func (p *errPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	return balancer.PickResult{}, p.err
+}
+
+// gcpPicker picks the ready SubConn with the fewest active streams,
+// optionally breaking ties (or overriding) by observed latency when
+// ChannelPoolConfig.LatencyAwarePicking is set.
+//
+// apiConfig and metrics are snapshotted from gcpBalancer.cfg/metrics by
+// regeneratePickerLocked when it builds a gcpPicker, rather than read from
+// gb directly: gb.cfg and gb.metrics are replaced wholesale (never mutated
+// in place) under gb.mu by UpdateClientConnState, and Pick runs without
+// holding gb.mu, so reading them straight off gb would race with a
+// concurrent config update.
+type gcpPicker struct {
+	gb     *gcpBalancer
+	scRefs []*subConnRef
+
+	apiConfig *pb.ApiConfig
+	lap       *pb.LatencyAwarePicking
+	metrics   MetricsSink
+}
+
+// Pick routes by affinity when the invoked method is configured with an
+// AffinityConfig and the caller set an affinity key on the context (see
+// NewContextWithAffinityKey); otherwise it falls back to (and BIND always
+// uses) the least-busy-SubConn logic below.
+func (p *gcpPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	lap := p.lap
+	aff := affinityConfigForMethod(p.apiConfig, info.FullMethodName)
+
+	var key string
+	var haveKey bool
+	if aff != nil {
+		key, haveKey = affinityKeyFromContext(info.Ctx)
+	}
+
+	// BOUND and UNBIND both route to the SubConn already bound to key;
+	// UNBIND additionally drops the binding once it has been resolved.
+	if aff != nil && haveKey && aff.Command != pb.AffinityConfig_BIND {
+		if ref, ok := p.boundReady(key); ok {
+			if aff.Command == pb.AffinityConfig_UNBIND {
+				p.gb.unbindSubConn(key)
+			}
+			return p.pickRef(ref, lap), nil
+		}
+		if !p.apiConfig.ChannelPool.FallbackToReady {
+			return balancer.PickResult{}, status.Errorf(codes.Unavailable, "grpcgcp: no SubConn bound for affinity key %q", key)
+		}
+		p.metrics.RecordFallback()
+	}
+
+	if len(p.scRefs) == 0 {
+		return balancer.PickResult{}, balancer.ErrNoSubConnAvailable
+	}
+
+	best := p.scRefs[0]
+	bestScore := p.score(best, lap)
+	for _, ref := range p.scRefs[1:] {
+		if s := p.score(ref, lap); s < bestScore {
+			best = ref
+			bestScore = s
+		}
+	}
+
+	// BIND always picks by load, then binds the resulting SubConn to key
+	// for subsequent BOUND/UNBIND calls.
+	if aff != nil && haveKey && aff.Command == pb.AffinityConfig_BIND {
+		p.gb.bindSubConn(key, best)
+	}
+
+	return p.pickRef(best, lap), nil
+}
+
+// boundReady looks up the SubConn bound to key and reports whether it is
+// part of this picker's ready set. A binding pointing at a SubConn that
+// has since been replaced or gone unready is treated as not found, same as
+// no binding at all.
+func (p *gcpPicker) boundReady(key string) (*subConnRef, bool) {
+	ref, ok := p.gb.boundSubConn(key)
+	if !ok {
+		return nil, false
+	}
+	for _, r := range p.scRefs {
+		if r == ref {
+			return ref, true
+		}
+	}
+	return nil, false
+}
+
+// pickRef wraps ref in a PickResult: it tracks the active stream count
+// used by score, records the latency EWMA when lap is set, may grow the
+// pool once ref's load crosses MaxConcurrentStreamsLowWatermark, and
+// drives the unresponsive-SubConn detection from the call's Done callback.
+func (p *gcpPicker) pickRef(ref *subConnRef, lap *pb.LatencyAwarePicking) balancer.PickResult {
+	ref.incStreams(1)
+	p.gb.maybeGrowPool(ref)
+	start := time.Now()
+	return balancer.PickResult{
+		SubConn: ref.subConn,
+		Done: func(info balancer.DoneInfo) {
+			ref.incStreams(-1)
+			// Deadline-exceeded calls are excluded from the latency EWMA so
+			// a stalled SubConn's score doesn't improve while it is in fact
+			// the unresponsive-detection logic's job to refresh it.
+			if lap != nil && !isDeadlineExceeded(info.Err) {
+				ref.recordLatency(time.Since(start), lap.WindowMs)
+			}
+			p.gb.handleDone(ref, info)
+		},
+	}
+}
+
+// score combines active stream count with normalized latency
+// (observed EWMA latency divided by the configured window) so SubConns
+// with similar load are chosen based on responsiveness.
+func (p *gcpPicker) score(ref *subConnRef, lap *pb.LatencyAwarePicking) float64 {
+	streams := float64(ref.getStreams())
+	if lap == nil || lap.WindowMs == 0 {
+		return streams
+	}
+	normalizedLatency := float64(ref.Latency().Milliseconds()) / float64(lap.WindowMs)
+	return streams + lap.Weight*normalizedLatency
+}
@@ -0,0 +1,223 @@
+// Package grpc_gcp holds the types mirroring the gRPC-GCP channel pool
+// configuration (grpc.gcp.ApiConfig and friends). They are consumed by the
+// grpcgcp package to configure the custom "grpc.gcp" balancer.
+//
+// These are plain Go structs, not protoc-gen-go output: they do not
+// implement proto.Message, so the service config they describe is decoded
+// and compared with encoding/json rather than protojson/protocmp. The
+// protobuf struct tags are kept as documentation of the wire field numbers
+// and names the shape is modeled on.
+package grpc_gcp
+
+// AffinityConfig_Command is the affinity operation to apply for a method.
+type AffinityConfig_Command int32
+
+const (
+	AffinityConfig_BOUND  AffinityConfig_Command = 0
+	AffinityConfig_BIND   AffinityConfig_Command = 1
+	AffinityConfig_UNBIND AffinityConfig_Command = 2
+)
+
+var affinityConfigCommandName = map[AffinityConfig_Command]string{
+	AffinityConfig_BOUND:  "BOUND",
+	AffinityConfig_BIND:   "BIND",
+	AffinityConfig_UNBIND: "UNBIND",
+}
+
+func (c AffinityConfig_Command) String() string {
+	if name, ok := affinityConfigCommandName[c]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
+
+// AffinityConfig describes how a method binds or resolves a channel by key.
+type AffinityConfig struct {
+	Command     AffinityConfig_Command `protobuf:"varint,1,opt,name=command,proto3,enum=grpc.gcp.AffinityConfig_Command" json:"command,omitempty"`
+	AffinityKey string                 `protobuf:"bytes,2,opt,name=affinity_key,json=affinityKey,proto3" json:"affinity_key,omitempty"`
+}
+
+func (x *AffinityConfig) GetCommand() AffinityConfig_Command {
+	if x != nil {
+		return x.Command
+	}
+	return AffinityConfig_BOUND
+}
+
+func (x *AffinityConfig) GetAffinityKey() string {
+	if x != nil {
+		return x.AffinityKey
+	}
+	return ""
+}
+
+// MethodConfig maps one or more method names to an affinity operation.
+type MethodConfig struct {
+	Name     []string        `protobuf:"bytes,1,rep,name=name,proto3" json:"name,omitempty"`
+	Affinity *AffinityConfig `protobuf:"bytes,2,opt,name=affinity,proto3" json:"affinity,omitempty"`
+}
+
+func (x *MethodConfig) GetName() []string {
+	if x != nil {
+		return x.Name
+	}
+	return nil
+}
+
+func (x *MethodConfig) GetAffinity() *AffinityConfig {
+	if x != nil {
+		return x.Affinity
+	}
+	return nil
+}
+
+// ChannelPoolConfig controls the size of the pool and when a SubConn is
+// considered unresponsive and should be refreshed.
+type ChannelPoolConfig struct {
+	MinSize                          uint32 `protobuf:"varint,1,opt,name=min_size,json=minSize,proto3" json:"min_size,omitempty"`
+	MaxSize                          uint32 `protobuf:"varint,2,opt,name=max_size,json=maxSize,proto3" json:"max_size,omitempty"`
+	MaxConcurrentStreamsLowWatermark uint32 `protobuf:"varint,3,opt,name=max_concurrent_streams_low_watermark,json=maxConcurrentStreamsLowWatermark,proto3" json:"max_concurrent_streams_low_watermark,omitempty"`
+	// FallbackToReady, when set, makes a BOUND or UNBIND pick that finds no
+	// SubConn bound for its affinity key fall back to the normal
+	// least-busy-SubConn pick instead of failing with Unavailable.
+	FallbackToReady bool `protobuf:"varint,4,opt,name=fallback_to_ready,json=fallbackToReady,proto3" json:"fallback_to_ready,omitempty"`
+	// UnresponsiveDetectionMs and UnresponsiveCalls gate the DEADLINE_EXCEEDED
+	// based unresponsive-SubConn detection: a SubConn is refreshed once at
+	// least UnresponsiveCalls consecutive deadline-exceeded completions are
+	// observed and at least UnresponsiveDetectionMs has passed since the last
+	// non-deadline-exceeded completion.
+	UnresponsiveDetectionMs uint32 `protobuf:"varint,5,opt,name=unresponsive_detection_ms,json=unresponsiveDetectionMs,proto3" json:"unresponsive_detection_ms,omitempty"`
+	UnresponsiveCalls       uint32 `protobuf:"varint,6,opt,name=unresponsive_calls,json=unresponsiveCalls,proto3" json:"unresponsive_calls,omitempty"`
+	// LatencyAwarePicking, when set, makes the picker break ties (and
+	// optionally override) the stream-count based choice using each
+	// SubConn's observed RPC latency.
+	LatencyAwarePicking *LatencyAwarePicking `protobuf:"bytes,7,opt,name=latency_aware_picking,json=latencyAwarePicking,proto3" json:"latency_aware_picking,omitempty"`
+	// HealthCheck, when set, enables an alternative/complementary
+	// unresponsive-SubConn detection mode based on the standard gRPC health
+	// checking protocol instead of (or alongside) deadline-exceeded RPCs.
+	HealthCheck *HealthCheckConfig `protobuf:"bytes,8,opt,name=health_check,json=healthCheck,proto3" json:"health_check,omitempty"`
+}
+
+// HealthCheckConfig configures per-SubConn grpc.health.v1.Health/Watch
+// based unresponsiveness detection.
+type HealthCheckConfig struct {
+	// ServiceName is the service name passed in the HealthCheckRequest.
+	ServiceName string `protobuf:"bytes,1,opt,name=service_name,json=serviceName,proto3" json:"service_name,omitempty"`
+	// UnhealthyThresholdMs is how long a SubConn must be reported
+	// NOT_SERVING, or the Watch stream must stay broken, before the SubConn
+	// is refreshed.
+	UnhealthyThresholdMs uint32 `protobuf:"varint,2,opt,name=unhealthy_threshold_ms,json=unhealthyThresholdMs,proto3" json:"unhealthy_threshold_ms,omitempty"`
+}
+
+func (x *HealthCheckConfig) GetServiceName() string {
+	if x != nil {
+		return x.ServiceName
+	}
+	return ""
+}
+
+func (x *HealthCheckConfig) GetUnhealthyThresholdMs() uint32 {
+	if x != nil {
+		return x.UnhealthyThresholdMs
+	}
+	return 0
+}
+
+// LatencyAwarePicking configures the latency EWMA used by the picker.
+type LatencyAwarePicking struct {
+	// WindowMs is the decay window for the latency EWMA: samples older than
+	// roughly WindowMs contribute little to the running average.
+	WindowMs uint32 `protobuf:"varint,1,opt,name=window_ms,json=windowMs,proto3" json:"window_ms,omitempty"`
+	// Weight scales the normalized latency term in the picker's score.
+	Weight float64 `protobuf:"fixed64,2,opt,name=weight,proto3" json:"weight,omitempty"`
+}
+
+func (x *LatencyAwarePicking) GetWindowMs() uint32 {
+	if x != nil {
+		return x.WindowMs
+	}
+	return 0
+}
+
+func (x *LatencyAwarePicking) GetWeight() float64 {
+	if x != nil {
+		return x.Weight
+	}
+	return 0
+}
+
+func (x *ChannelPoolConfig) GetMinSize() uint32 {
+	if x != nil {
+		return x.MinSize
+	}
+	return 0
+}
+
+func (x *ChannelPoolConfig) GetMaxSize() uint32 {
+	if x != nil {
+		return x.MaxSize
+	}
+	return 0
+}
+
+func (x *ChannelPoolConfig) GetMaxConcurrentStreamsLowWatermark() uint32 {
+	if x != nil {
+		return x.MaxConcurrentStreamsLowWatermark
+	}
+	return 0
+}
+
+func (x *ChannelPoolConfig) GetFallbackToReady() bool {
+	if x != nil {
+		return x.FallbackToReady
+	}
+	return false
+}
+
+func (x *ChannelPoolConfig) GetUnresponsiveDetectionMs() uint32 {
+	if x != nil {
+		return x.UnresponsiveDetectionMs
+	}
+	return 0
+}
+
+func (x *ChannelPoolConfig) GetUnresponsiveCalls() uint32 {
+	if x != nil {
+		return x.UnresponsiveCalls
+	}
+	return 0
+}
+
+func (x *ChannelPoolConfig) GetLatencyAwarePicking() *LatencyAwarePicking {
+	if x != nil {
+		return x.LatencyAwarePicking
+	}
+	return nil
+}
+
+func (x *ChannelPoolConfig) GetHealthCheck() *HealthCheckConfig {
+	if x != nil {
+		return x.HealthCheck
+	}
+	return nil
+}
+
+// ApiConfig is the top level "grpc.gcp" service config message.
+type ApiConfig struct {
+	ChannelPool *ChannelPoolConfig `protobuf:"bytes,1,opt,name=channel_pool,json=channelPool,proto3" json:"channel_pool,omitempty"`
+	Method      []*MethodConfig    `protobuf:"bytes,2,rep,name=method,proto3" json:"method,omitempty"`
+}
+
+func (x *ApiConfig) GetChannelPool() *ChannelPoolConfig {
+	if x != nil {
+		return x.ChannelPool
+	}
+	return nil
+}
+
+func (x *ApiConfig) GetMethod() []*MethodConfig {
+	if x != nil {
+		return x.Method
+	}
+	return nil
+}